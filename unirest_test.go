@@ -0,0 +1,205 @@
+package unirest
+
+import (
+  "context"
+  "net"
+  "net/http"
+  "net/http/cookiejar"
+  "net/http/httptest"
+  "net/http/httptrace"
+  "sync/atomic"
+  "testing"
+  "time"
+)
+
+// TestEndDoesNotLeakCookieJarAcrossRequests guards against regressing to the
+// old behavior where End() mutated a shared *http.Client in place: setting a
+// CookieJar on one request must not cause a later request without one to
+// start sending cookies from it.
+func TestEndDoesNotLeakCookieJarAcrossRequests(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+    if req.URL.Path == "/set" {
+      http.SetCookie(w, &http.Cookie{Name: "session", Value: "leaked"})
+      return
+    }
+
+    if _, err := req.Cookie("session"); err == nil {
+      w.Header().Set("X-Saw-Cookie", "1")
+    }
+  }))
+  defer server.Close()
+
+  jar, err := cookiejar.New(nil)
+  if err != nil {
+    t.Fatalf("cookiejar.New: %v", err)
+  }
+
+  first := Request{Method: "GET", Url: server.URL + "/set", CookieJar: jar}
+  if _, err := first.End(); err != nil {
+    t.Fatalf("first request: %v", err)
+  }
+
+  second := Request{Method: "GET", Url: server.URL + "/check"}
+  res, err := second.End()
+  if err != nil {
+    t.Fatalf("second request: %v", err)
+  }
+  if res.Header.Get("X-Saw-Cookie") != "" {
+    t.Fatalf("second request sent a cookie from the first request's jar")
+  }
+}
+
+// TestBackoffNoOverflow guards against the int64 overflow in backoff's
+// doubling: a large MaxAttempts with an ordinary BaseDelay must still
+// produce a sane, non-negative delay instead of wrapping around and
+// crashing rand.Int63n.
+func TestBackoffNoOverflow(t *testing.T) {
+  policy := &RetryPolicy{
+    MaxAttempts: 38,
+    BaseDelay:   100 * time.Millisecond,
+    MaxDelay:    time.Minute,
+  }
+
+  for attempt := 1; attempt <= 40; attempt++ {
+    delay := policy.backoff(attempt, nil)
+    if delay < 0 {
+      t.Fatalf("attempt %d: backoff returned negative delay %s", attempt, delay)
+    }
+    if delay > policy.MaxDelay {
+      t.Fatalf("attempt %d: backoff returned %s, exceeding MaxDelay %s", attempt, delay, policy.MaxDelay)
+    }
+  }
+}
+
+// TestCanceledContextAbortsRetriesQuickly guards against the retry loop
+// ignoring a canceled Context: End must give up on the first attempt
+// instead of burning through the whole RetryPolicy's backoff schedule.
+func TestCanceledContextAbortsRetriesQuickly(t *testing.T) {
+  ctx, cancel := context.WithCancel(context.Background())
+  cancel()
+
+  r := Request{
+    Method:  "GET",
+    Url:     "http://127.0.0.1:1/unreachable",
+    Context: ctx,
+    RetryPolicy: &RetryPolicy{
+      MaxAttempts: 5,
+      BaseDelay:   200 * time.Millisecond,
+    },
+  }
+
+  start := time.Now()
+  if _, err := r.End(); err == nil {
+    t.Fatalf("expected error")
+  }
+
+  if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+    t.Fatalf("expected End to abort quickly on a canceled context, took %s", elapsed)
+  }
+}
+
+// TestEndReusesConnectionsAcrossRequests guards against gating the
+// transport clone in End() on transport.TLSClientConfig != nil: the
+// stdlib itself sets TLSClientConfig on a Transport with
+// ForceAttemptHTTP2 the first time it's used, even over plain HTTP, so
+// that check alone would clone onto a fresh, empty connection pool on
+// every request after the first and defeat pooling entirely.
+func TestEndReusesConnectionsAcrossRequests(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+  defer server.Close()
+
+  transport := &http.Transport{ForceAttemptHTTP2: true}
+  defer transport.CloseIdleConnections()
+
+  doRequest := func() bool {
+    var reused bool
+    trace := &httptrace.ClientTrace{
+      GotConn: func(info httptrace.GotConnInfo) {
+        reused = info.Reused
+      },
+    }
+
+    r := Request{
+      Method:    "GET",
+      Url:       server.URL,
+      Transport: transport,
+      Context:   httptrace.WithClientTrace(context.Background(), trace),
+    }
+
+    if _, err := r.End(); err != nil {
+      t.Fatalf("End: %v", err)
+    }
+
+    return reused
+  }
+
+  if reused := doRequest(); reused {
+    t.Fatalf("first request unexpectedly reused a connection")
+  }
+
+  // Give the first response's connection a moment to become idle.
+  time.Sleep(50 * time.Millisecond)
+
+  if reused := doRequest(); !reused {
+    t.Fatalf("second request did not reuse the first request's connection")
+  }
+}
+
+// TestEndRetriesReuseConnection guards against leaving a discarded
+// attempt's Body undrained/unclosed: if that body is never read to EOF,
+// the underlying connection can't be returned to the pool, so every
+// retried attempt opens a brand-new TCP connection instead of reusing
+// one.
+func TestEndRetriesReuseConnection(t *testing.T) {
+  var failuresLeft int32 = 2
+  var newConns int32
+
+  server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+    if atomic.AddInt32(&failuresLeft, -1) >= 0 {
+      w.WriteHeader(http.StatusServiceUnavailable)
+      // A non-trivial body matters here: an empty body is already at EOF
+      // by the time headers are parsed, masking the undrained-body bug
+      // this test exists to catch.
+      w.Write([]byte("service unavailable, please retry later"))
+      return
+    }
+
+    w.WriteHeader(http.StatusOK)
+  }))
+  server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+    if state == http.StateNew {
+      atomic.AddInt32(&newConns, 1)
+    }
+  }
+  server.Start()
+  defer server.Close()
+
+  transport := &http.Transport{}
+  defer transport.CloseIdleConnections()
+
+  r := Request{
+    Method:    "GET",
+    Url:       server.URL,
+    Transport: transport,
+    RetryPolicy: &RetryPolicy{
+      MaxAttempts:   3,
+      BaseDelay:     time.Millisecond,
+      RetryOnStatus: []int{http.StatusServiceUnavailable},
+    },
+  }
+
+  res, err := r.End()
+  if err != nil {
+    t.Fatalf("End: %v", err)
+  }
+  if res.StatusCode != http.StatusOK {
+    t.Fatalf("expected the final retry to succeed, got status %d", res.StatusCode)
+  }
+
+  // Give the server a moment to record the connection state transitions.
+  time.Sleep(50 * time.Millisecond)
+
+  if got := atomic.LoadInt32(&newConns); got != 1 {
+    t.Fatalf("expected retries to reuse a single connection, opened %d", got)
+  }
+}